@@ -3,6 +3,8 @@ package cas
 import (
 	"fmt"
 	"net/http"
+
+	"github.com/golang/glog"
 )
 
 const (
@@ -51,22 +53,54 @@ func IsSingleLogoutRequest(r *http.Request) bool {
 	return true
 }
 
-// performSingleLogout processes a single logout request
+// performSingleLogout processes a single logout request.
+//
+// If the Client has an SLOVerifier configured, the request's signature is
+// checked against it first and unsigned/invalid requests are rejected --
+// previously any POSTed logoutRequest was trusted outright. The
+// logoutRequest is then parsed from the verifier's own re-serialized output,
+// not the original POST body: Verify only certifies that some element in
+// rawXML was correctly signed, so parsing rawXML itself would let an
+// XML Signature Wrapping attack splice an attacker-controlled logoutRequest
+// in next to a validly signed-but-unrelated element. The session's ticket is
+// then deleted with retries, since a 500 on a transient TicketStore error
+// just loses the logout; CAS only retries a failed back-channel logout for a
+// 503. SLOListener lets applications invalidate whatever they keep of their
+// own session state (the old deleteSession call this replaces never worked,
+// since the CAS session index isn't a key into the application's own session
+// store). SLOBroadcast, if set, relays the event to other instances sharing
+// this Client's TicketStore.
 func (ch *clientHandler) performSingleLogout(w http.ResponseWriter, r *http.Request) {
-	rawXML := r.FormValue("logoutRequest")
-	logoutRequest, err := parseLogoutRequest([]byte(rawXML))
+	rawXML := []byte(r.FormValue("logoutRequest"))
+	verifiedXML := rawXML
+
+	if ch.c.sloVerifier != nil {
+		v, err := ch.c.sloVerifier.Verify(rawXML)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("cas: slo: %v", err), http.StatusBadRequest)
+			return
+		}
+		verifiedXML = v
+	}
 
+	logoutRequest, err := parseLogoutRequest(verifiedXML)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if err := ch.c.tickets.Delete(logoutRequest.SessionIndex); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := ch.c.HandleRemoteLogout(logoutRequest.SessionIndex, logoutRequest.NameID); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
 		return
 	}
 
-	//ch.c.deleteSession(logoutRequest.SessionIndex)	wrong use, this 'session index' is not in session store
+	if ch.c.sloBroadcast != nil {
+		select {
+		case ch.c.sloBroadcast <- SLOEvent{SessionIndex: logoutRequest.SessionIndex, NameID: logoutRequest.NameID, OriginID: LocalSLOInstanceID()}:
+		default:
+			glog.Warningf("cas: slo: broadcast channel full, dropping event for session %v", logoutRequest.SessionIndex)
+		}
+	}
 
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintln(w, "OK")
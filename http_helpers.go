@@ -3,10 +3,12 @@ package cas
 import (
 	"context"
 	"errors"
-	"github.com/tmsong/hlog"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
+
+	"github.com/tmsong/hlog"
 )
 
 type key int
@@ -26,12 +28,22 @@ func SetClient(r *http.Request, c *Client) {
 //setClientWithLogger associates a new logger client with a http.Request
 func SetClientWithLogger(r *http.Request, c *Client, l *hlog.Logger) {
 	newCli := &Client{c.cli, l}
+	// Carry over the PGT store before constructing the validator: WithPGTURL
+	// only wires up its in-memory default when pgts is still nil, so this
+	// must happen first or a request served through SetClientWithLogger
+	// would silently get its own store instead of sharing c's.
+	newCli.pgts = c.pgts
+	opts := []ValidatorOption{WithResponseFormat(c.stValidator.responseFormat)}
+	if c.stValidator.pgtURL != "" {
+		opts = append(opts, WithPGTURL(c.stValidator.pgtURL))
+	}
 	newCli.stValidator = NewServiceTicketValidator(c.stValidator.client,
-		c.stValidator.casURL, c.stValidator.validationType, newCli)
+		c.stValidator.casURL, c.stValidator.validationType, newCli, opts...)
 	newCli.pmValidator = NewPermissionValidator(c.pmValidator.client,
 		c.pmValidator.permissionURL, newCli)
 	newCli.SetSessionStore(c.sessions.CopyWithParent(newCli))
 	newCli.SetTicketStore(c.tickets.CopyWithParent(newCli))
+	newCli.permCache = c.permCache
 	ctx := context.WithValue(r.Context(), clientKey, newCli)
 	r2 := r.WithContext(ctx)
 	*r = *r2
@@ -212,15 +224,19 @@ func SetCurrentUserId(r *http.Request, userId int64) {
 	return
 }
 
+// HasPermission reports whether the request's user may perform the request's
+// method against its path. When the Client has a permission cache
+// configured via SetPermissionCache, the result is served from cache where
+// possible instead of hitting the remote permission service on every call.
 func HasPermission(r *http.Request) bool {
 	c := GetClient(r)
 	if c == nil {
 		return false
 	}
-	if c.PermissionValidateForRequest(r) != nil {
-		return false
-	}
-	return true
+	key := CacheKey{User: Username(r), Resource: r.URL.Path, Action: r.Method}
+	return c.hasPermissionCached(key, func() error {
+		return c.PermissionValidateForRequest(r)
+	})
 }
 
 func RoleList(r *http.Request) ([]RoleListResponse, error) {
@@ -228,7 +244,13 @@ func RoleList(r *http.Request) ([]RoleListResponse, error) {
 	if c == nil {
 		return nil, errors.New("no client associated with request")
 	}
-	return c.RoleList(r)
+	v, err := c.callWithBreaker("roleList:"+Username(r), func() (interface{}, error) {
+		return c.RoleList(r)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]RoleListResponse), nil
 }
 
 func PermissionList(r *http.Request, roleId int64) ([]PermissionListResponse, error) {
@@ -236,7 +258,13 @@ func PermissionList(r *http.Request, roleId int64) ([]PermissionListResponse, er
 	if c == nil {
 		return nil, errors.New("no client associated with request")
 	}
-	return c.PermissionList(r, roleId)
+	v, err := c.callWithBreaker(fmt.Sprintf("permissionList:%v", roleId), func() (interface{}, error) {
+		return c.PermissionList(r, roleId)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]PermissionListResponse), nil
 }
 
 func UserInfo(r *http.Request, userId int64) (*UserInfoResponse, error) {
@@ -244,7 +272,13 @@ func UserInfo(r *http.Request, userId int64) (*UserInfoResponse, error) {
 	if c == nil {
 		return nil, errors.New("no client associated with request")
 	}
-	return c.UserInfo(userId)
+	v, err := c.callWithBreaker(fmt.Sprintf("userInfo:%v", userId), func() (interface{}, error) {
+		return c.UserInfo(userId)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*UserInfoResponse), nil
 }
 
 func UserInfoDetail(r *http.Request, userId int64) (*UserInfoResponse, error) {
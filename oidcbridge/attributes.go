@@ -0,0 +1,36 @@
+package oidcbridge
+
+// Claims is the subset of OIDC standard claims the bridge can derive from a
+// CAS AuthenticationResponse.
+type Claims struct {
+	Subject           string
+	PreferredUsername string
+	Email             string
+	Groups            []string
+}
+
+// AttributeMapper derives OIDC claims from a CAS session's user, attributes
+// and group membership. attributes mirrors cas.UserAttributes' underlying
+// map[string][]interface{} shape without this package importing cas, so
+// that cas.Client can implement Session and depend on oidcbridge without
+// creating an import cycle. The default mapper covers the common
+// KubeSphere-style deployment; applications with a different attribute
+// schema can supply their own via WithAttributeMapper.
+type AttributeMapper func(user string, attributes map[string][]interface{}, memberOf []string) Claims
+
+// DefaultAttributeMapper maps sub to User, preferred_username to User,
+// email to the "email" attribute (if present) and groups to MemberOf.
+func DefaultAttributeMapper(user string, attributes map[string][]interface{}, memberOf []string) Claims {
+	email := ""
+	if v, ok := attributes["email"]; ok && len(v) > 0 {
+		if s, ok := v[0].(string); ok {
+			email = s
+		}
+	}
+	return Claims{
+		Subject:           user,
+		PreferredUsername: user,
+		Email:             email,
+		Groups:            memberOf,
+	}
+}
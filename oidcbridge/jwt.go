@@ -0,0 +1,132 @@
+package oidcbridge
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// publicJWK renders pub as a JSON Web Key for the bridge's /jwks endpoint.
+func publicJWK(pub crypto.PublicKey, keyID string) (map[string]interface{}, error) {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return map[string]interface{}{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   b64(key.N.Bytes()),
+			"e":   b64(big32(key.E)),
+		}, nil
+	case *ecdsa.PublicKey:
+		return map[string]interface{}{
+			"kty": "EC",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "ES256",
+			"crv": key.Curve.Params().Name,
+			"x":   b64(key.X.Bytes()),
+			"y":   b64(key.Y.Bytes()),
+		}, nil
+	default:
+		return nil, fmt.Errorf("oidcbridge: unsupported public key type %T", pub)
+	}
+}
+
+func big32(i int) []byte {
+	b := []byte{byte(i >> 16), byte(i >> 8), byte(i)}
+	for len(b) > 1 && b[0] == 0 {
+		b = b[1:]
+	}
+	return b
+}
+
+// signingAlg returns the JWA alg header value for signer's key type, which
+// is all the bridge needs to know to build a correctly labelled ID token;
+// RS256 covers crypto/rsa keys and ES256 covers P-256 crypto/ecdsa keys;
+// ECDSA keys on any other curve are rejected.
+func signingAlg(signer crypto.Signer) (string, error) {
+	switch key := signer.Public().(type) {
+	case *rsa.PublicKey:
+		return "RS256", nil
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return "", fmt.Errorf("oidcbridge: unsupported ecdsa curve %v, only P-256 (ES256) is supported", key.Curve.Params().Name)
+		}
+		return "ES256", nil
+	default:
+		return "", fmt.Errorf("oidcbridge: unsupported signer key type %T", signer.Public())
+	}
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signJWT builds and signs a compact JWS over claims, producing an ID token.
+func signJWT(signer crypto.Signer, keyID string, claims interface{}) (string, error) {
+	alg, err := signingAlg(signer)
+	if err != nil {
+		return "", err
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT", "kid": keyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := b64(header) + "." + b64(payload)
+
+	hashed := crypto.SHA256.New()
+	hashed.Write([]byte(signingInput))
+	digest := hashed.Sum(nil)
+
+	// Switch on the public key type rather than the concrete signer type --
+	// signer is a crypto.Signer and plenty of real ones (e.g. an HSM- or
+	// KMS-backed key) aren't a *rsa.PrivateKey/*ecdsa.PrivateKey at all, but
+	// their Public() still tells us which JWS encoding the result needs.
+	var sig []byte
+	switch pub := signer.Public().(type) {
+	case *rsa.PublicKey:
+		// Go through crypto.Signer rather than asserting *rsa.PrivateKey so
+		// HSM/KMS-backed RSA signers work too: passing a plain crypto.Hash as
+		// opts (rather than an *rsa.PSSOptions) is what tells an RSA signer's
+		// Sign to produce the PKCS#1v1.5 signature RS256 needs.
+		sig, err = signer.Sign(rand.Reader, digest, crypto.SHA256)
+	case *ecdsa.PublicKey:
+		// crypto.Signer.Sign returns an ASN.1 DER-encoded (r, s) pair for
+		// ECDSA keys, but JOSE/ES256 (RFC 7518 section 3.4) requires the raw
+		// fixed-width r||s concatenation instead. Unmarshal the DER and
+		// re-pack each coordinate into the curve's byte length.
+		der, signErr := signer.Sign(rand.Reader, digest, crypto.SHA256)
+		if signErr != nil {
+			return "", fmt.Errorf("oidcbridge: sign id token: %v", signErr)
+		}
+		var rs struct{ R, S *big.Int }
+		if _, err = asn1.Unmarshal(der, &rs); err != nil {
+			return "", fmt.Errorf("oidcbridge: decode ecdsa signature: %v", err)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		sig = make([]byte, 2*size)
+		rs.R.FillBytes(sig[:size])
+		rs.S.FillBytes(sig[size:])
+	default:
+		return "", fmt.Errorf("oidcbridge: unsupported signer key type %T", pub)
+	}
+	if err != nil {
+		return "", fmt.Errorf("oidcbridge: sign id token: %v", err)
+	}
+
+	return signingInput + "." + b64(sig), nil
+}
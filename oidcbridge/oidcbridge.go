@@ -0,0 +1,359 @@
+// Package oidcbridge re-exports a CAS session as an OIDC-compliant upstream,
+// so that OIDC-only services (the Kubernetes API server, Grafana, and
+// similar) can authenticate against a CAS deployment through this client
+// library without standing up a separate Dex/Keycloak hop -- the same role
+// the KubeSphere CAS identity provider integration plays for Kubernetes.
+package oidcbridge
+
+import (
+	"crypto"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	codeTTL        = 60 * time.Second
+	accessTokenTTL = time.Hour
+)
+
+// Session is the CAS-session surface the bridge needs. *cas.Client
+// implements it; it's expressed as an interface here (rather than imported
+// directly) so that cas can depend on oidcbridge without the two packages
+// importing each other.
+type Session interface {
+	// IsAuthenticated reports whether r carries a CAS-authenticated session.
+	IsAuthenticated(r *http.Request) bool
+	// RedirectToLogin sends the browser to the CAS login page.
+	RedirectToLogin(w http.ResponseWriter, r *http.Request)
+	// CurrentUser returns the authenticated user, attributes and group
+	// membership attached to r. Only meaningful once IsAuthenticated(r).
+	CurrentUser(r *http.Request) (user string, attributes map[string][]interface{}, memberOf []string)
+}
+
+// Bridge implements the handful of OIDC endpoints needed for an
+// authorization-code login against a CAS deployment.
+type Bridge struct {
+	session         Session
+	issuer          string
+	signer          crypto.Signer
+	keyID           string
+	attributeMapper AttributeMapper
+	clients         map[string]map[string]bool // client_id -> allowed redirect_uris
+
+	mu           sync.Mutex
+	codes        map[string]*authCode
+	accessTokens map[string]*accessToken
+}
+
+type authCode struct {
+	claims      Claims
+	clientID    string
+	redirectURI string
+	expiresAt   time.Time
+}
+
+// accessToken is the bearer token serveToken mints alongside an ID token, so
+// that unlike the authorization code it's minted from, it's independently
+// checkable by serveUserinfo -- a bare opaque copy of the (already consumed)
+// authorization code wouldn't be, and a server-to-server caller presenting
+// it per the OIDC userinfo spec would always get rejected.
+type accessToken struct {
+	claims    Claims
+	expiresAt time.Time
+}
+
+// Option configures optional Bridge behaviour.
+type Option func(*Bridge)
+
+// WithAttributeMapper overrides the mapping from CAS attributes to OIDC
+// claims. Defaults to DefaultAttributeMapper.
+func WithAttributeMapper(m AttributeMapper) Option {
+	return func(b *Bridge) { b.attributeMapper = m }
+}
+
+// WithKeyID sets the "kid" advertised in the JWKS document and ID token
+// header, letting callers rotate signing keys. Defaults to "default".
+func WithKeyID(keyID string) Option {
+	return func(b *Bridge) { b.keyID = keyID }
+}
+
+// WithClient registers a relying party allowed to use the bridge: clientID
+// and one of redirectURIs must be presented together at /authorize, and the
+// same redirectURI must be presented again at /token, or the request is
+// rejected. Without at least one registered client, /authorize refuses
+// every request -- there is no "allow any redirect_uri" default, since that
+// would let an attacker mint an authorization code for a victim's session
+// and have it delivered to a server of the attacker's choosing.
+func WithClient(clientID string, redirectURIs ...string) Option {
+	return func(b *Bridge) {
+		allowed := make(map[string]bool, len(redirectURIs))
+		for _, u := range redirectURIs {
+			allowed[u] = true
+		}
+		b.clients[clientID] = allowed
+	}
+}
+
+// New creates a Bridge that re-exports session as an OIDC upstream under
+// issuer, signing ID tokens with signer. Register at least one relying
+// party with WithClient before serving /authorize.
+func New(session Session, issuer string, signer crypto.Signer, opts ...Option) *Bridge {
+	b := &Bridge{
+		session:         session,
+		issuer:          strings.TrimSuffix(issuer, "/"),
+		signer:          signer,
+		keyID:           "default",
+		attributeMapper: DefaultAttributeMapper,
+		clients:         make(map[string]map[string]bool),
+		codes:           make(map[string]*authCode),
+		accessTokens:    make(map[string]*accessToken),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// pruneExpiredLocked evicts expired codes and access tokens. b.mu must be
+// held. Authorization codes are only otherwise removed on redemption, so a
+// code minted by serveAuthorize and never redeemed (abandoned tab, browser
+// back/refresh) would sit in b.codes for the life of the process without
+// this; called on every serveAuthorize/serveToken mint so the maps stay
+// bounded by recent traffic rather than by how many codes/tokens ever
+// existed.
+func (b *Bridge) pruneExpiredLocked() {
+	now := time.Now()
+	for code, entry := range b.codes {
+		if now.After(entry.expiresAt) {
+			delete(b.codes, code)
+		}
+	}
+	for token, entry := range b.accessTokens {
+		if now.After(entry.expiresAt) {
+			delete(b.accessTokens, token)
+		}
+	}
+}
+
+// Handler returns the http.Handler mounting the bridge's OIDC endpoints.
+// Callers typically mount it at the root of a dedicated host or path prefix
+// matching issuer.
+func (b *Bridge) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", b.serveDiscovery)
+	mux.HandleFunc("/jwks", b.serveJWKS)
+	mux.HandleFunc("/authorize", b.serveAuthorize)
+	mux.HandleFunc("/token", b.serveToken)
+	mux.HandleFunc("/userinfo", b.serveUserinfo)
+	return mux
+}
+
+func (b *Bridge) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	alg, err := signingAlg(b.signer)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"issuer":                                b.issuer,
+		"authorization_endpoint":                b.issuer + "/authorize",
+		"token_endpoint":                        b.issuer + "/token",
+		"userinfo_endpoint":                     b.issuer + "/userinfo",
+		"jwks_uri":                              b.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{alg},
+		"scopes_supported":                      []string{"openid", "profile", "email", "groups"},
+		"claims_supported":                      []string{"sub", "preferred_username", "email", "groups"},
+	})
+}
+
+func (b *Bridge) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	jwk, err := publicJWK(b.signer.Public(), b.keyID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]interface{}{"keys": []interface{}{jwk}})
+}
+
+// serveAuthorize wraps the existing CAS login redirect: unauthenticated
+// requests are bounced to RedirectToLogin, and once CAS has attached a
+// session to the request an authorization code is minted and the browser is
+// sent back to redirect_uri per the OIDC authorization code flow.
+//
+// client_id must name a client registered with WithClient, and redirect_uri
+// must be one of the URIs registered for it -- otherwise the request is
+// rejected before the browser is ever redirected anywhere, so an attacker
+// can't use this endpoint to mint a code bound to an arbitrary redirect_uri
+// of their choosing.
+func (b *Bridge) serveAuthorize(w http.ResponseWriter, r *http.Request) {
+	clientID := r.URL.Query().Get("client_id")
+	redirectURI := r.URL.Query().Get("redirect_uri")
+	allowed, ok := b.clients[clientID]
+	if !ok || !allowed[redirectURI] {
+		http.Error(w, "oidcbridge: unknown client_id or redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	if !b.session.IsAuthenticated(r) {
+		b.session.RedirectToLogin(w, r)
+		return
+	}
+
+	state := r.URL.Query().Get("state")
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "oidcbridge: invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code, err := randomToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user, attributes, memberOf := b.session.CurrentUser(r)
+	b.mu.Lock()
+	b.pruneExpiredLocked()
+	b.codes[code] = &authCode{
+		claims:      b.attributeMapper(user, attributes, memberOf),
+		clientID:    clientID,
+		redirectURI: redirectURI,
+		expiresAt:   time.Now().Add(codeTTL),
+	}
+	b.mu.Unlock()
+
+	q := target.Query()
+	q.Set("code", code)
+	if state != "" {
+		q.Set("state", state)
+	}
+	target.RawQuery = q.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// serveToken exchanges an authorization code minted by serveAuthorize for an
+// ID token whose claims come from attributeMapper applied to the session the
+// code was issued for.
+//
+// client_id and redirect_uri must match what was presented at /authorize
+// when the code was issued, per RFC 6749 section 4.1.3 -- without this
+// check, a code intercepted in transit to one redirect_uri (e.g. via a
+// malicious app sharing a mobile OS's custom URI scheme) could be redeemed
+// by presenting a different redirect_uri the attacker controls.
+func (b *Bridge) serveToken(w http.ResponseWriter, r *http.Request) {
+	code := r.FormValue("code")
+
+	b.mu.Lock()
+	entry, ok := b.codes[code]
+	if ok {
+		delete(b.codes, code)
+	}
+	b.mu.Unlock()
+
+	if !ok || time.Now().After(entry.expiresAt) {
+		http.Error(w, "oidcbridge: invalid or expired code", http.StatusBadRequest)
+		return
+	}
+	if r.FormValue("client_id") != entry.clientID || r.FormValue("redirect_uri") != entry.redirectURI {
+		http.Error(w, "oidcbridge: client_id or redirect_uri does not match the authorization request", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	idToken, err := signJWT(b.signer, b.keyID, map[string]interface{}{
+		"iss":                b.issuer,
+		"sub":                entry.claims.Subject,
+		"aud":                entry.clientID,
+		"exp":                now.Add(time.Hour).Unix(),
+		"iat":                now.Unix(),
+		"preferred_username": entry.claims.PreferredUsername,
+		"email":              entry.claims.Email,
+		"groups":             entry.claims.Groups,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	accessTok, err := randomToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	b.mu.Lock()
+	b.pruneExpiredLocked()
+	b.accessTokens[accessTok] = &accessToken{claims: entry.claims, expiresAt: now.Add(accessTokenTTL)}
+	b.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"access_token": accessTok,
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+		"expires_in":   int(accessTokenTTL.Seconds()),
+	})
+}
+
+// serveUserinfo renders OIDC claims for the bearer access_token presented in
+// the Authorization header, per the OIDC userinfo spec, falling back to the
+// CAS session already attached to the request by GetSession when the caller
+// didn't send one -- e.g. a browser hitting /userinfo directly with its CAS
+// cookie rather than the access_token from /token.
+func (b *Bridge) serveUserinfo(w http.ResponseWriter, r *http.Request) {
+	var claims Claims
+	if tok := bearerToken(r); tok != "" {
+		b.mu.Lock()
+		entry, ok := b.accessTokens[tok]
+		b.mu.Unlock()
+		if !ok || time.Now().After(entry.expiresAt) {
+			http.Error(w, "oidcbridge: invalid or expired access token", http.StatusUnauthorized)
+			return
+		}
+		claims = entry.claims
+	} else if b.session.IsAuthenticated(r) {
+		user, attributes, memberOf := b.session.CurrentUser(r)
+		claims = b.attributeMapper(user, attributes, memberOf)
+	} else {
+		http.Error(w, "oidcbridge: no access token or cas session on request", http.StatusUnauthorized)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"sub":                claims.Subject,
+		"preferred_username": claims.PreferredUsername,
+		"email":              claims.Email,
+		"groups":             claims.Groups,
+	})
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>"
+// header, or "" if the header is absent or a different scheme.
+func bearerToken(r *http.Request) string {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) {
+		return ""
+	}
+	return strings.TrimPrefix(auth, prefix)
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("oidcbridge: generate code: %v", err)
+	}
+	return b64(buf), nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,28 @@
+package cas
+
+import (
+	"crypto"
+	"net/http"
+
+	"github.com/tmsong/cas-go-client/oidcbridge"
+)
+
+// OIDCBridge re-exports the Client's CAS session as an OIDC-compliant
+// upstream under issuer, with ID tokens signed by signer. See package
+// oidcbridge for the endpoints served and how attributes are mapped to
+// claims.
+func (c *Client) OIDCBridge(issuer string, signer crypto.Signer, opts ...oidcbridge.Option) http.Handler {
+	return oidcbridge.New(c, issuer, signer, opts...).Handler()
+}
+
+// IsAuthenticated reports whether r carries a CAS-authenticated session.
+// It satisfies oidcbridge.Session.
+func (c *Client) IsAuthenticated(r *http.Request) bool {
+	return IsAuthenticated(r)
+}
+
+// CurrentUser returns the authenticated user, attributes and group
+// membership attached to r. It satisfies oidcbridge.Session.
+func (c *Client) CurrentUser(r *http.Request) (user string, attributes map[string][]interface{}, memberOf []string) {
+	return Username(r), map[string][]interface{}(Attributes(r)), MemberOf(r)
+}
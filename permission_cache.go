@@ -0,0 +1,203 @@
+package cas
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sony/gobreaker"
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheKey identifies a single permission check.
+type CacheKey struct {
+	User     string
+	Resource string
+	Action   string
+}
+
+func (k CacheKey) String() string {
+	return fmt.Sprintf("%s|%s|%s", k.User, k.Resource, k.Action)
+}
+
+// PermissionCache is the extension point for caching permission check
+// results. allowed is only meaningful when found is true. NewLRUPermissionCache
+// provides an in-memory default; see subpackage permredis for a Redis-backed
+// implementation shared across instances.
+type PermissionCache interface {
+	Get(key CacheKey) (allowed bool, found bool)
+	// GetStale returns the last cached result for key even if it has expired,
+	// for FailurePolicyServeStale to fall back to while the breaker is open.
+	// Implementations must retain an expired entry until it's evicted or
+	// invalidated rather than dropping it the moment Get would no longer
+	// return it, or ServeStale has nothing left to serve.
+	GetStale(key CacheKey) (allowed bool, found bool)
+	Set(key CacheKey, allowed bool, ttl time.Duration)
+	Invalidate(key CacheKey)
+}
+
+// FailurePolicy decides how a cached permission check behaves once the
+// circuit breaker guarding the upstream permission service trips open.
+type FailurePolicy int
+
+const (
+	// FailurePolicyDenyAll is the previous, safe-by-default behaviour:
+	// treat every check as denied while the backend is unavailable.
+	FailurePolicyDenyAll FailurePolicy = iota
+	// FailurePolicyAllowAll lets every check through while the backend is
+	// unavailable. Only appropriate for non-critical resources.
+	FailurePolicyAllowAll
+	// FailurePolicyServeStale serves the last cached result for a key even
+	// past its TTL, falling back to deny if there's no cached entry at all.
+	FailurePolicyServeStale
+)
+
+// Observer receives cache and circuit breaker telemetry, for applications
+// that want to export it as metrics.
+type Observer interface {
+	OnCacheHit(key CacheKey)
+	OnCacheMiss(key CacheKey)
+	OnBreakerStateChange(name string, from, to gobreaker.State)
+}
+
+// PermissionCacheConfig configures the caching layer SetPermissionCache
+// installs in front of PermissionValidateForRequest. Zero value fields fall
+// back to conservative defaults.
+type PermissionCacheConfig struct {
+	// Cache backs the cache; defaults to an in-memory LRU of 1024 entries.
+	Cache PermissionCache
+	// AllowTTL and DenyTTL are the cache lifetimes for allow and deny
+	// results respectively. DenyTTL defaults shorter than AllowTTL so a
+	// revoked-then-regranted permission recovers quickly.
+	AllowTTL time.Duration
+	DenyTTL  time.Duration
+	// FailurePolicy governs behaviour while the breaker is open. Defaults
+	// to FailurePolicyDenyAll.
+	FailurePolicy FailurePolicy
+	// Observer, if set, is notified of cache hits/misses and breaker state
+	// transitions.
+	Observer Observer
+	// BreakerMaxFailures consecutive upstream failures trip the breaker
+	// open. Defaults to 5.
+	BreakerMaxFailures uint32
+	// BreakerTimeout is how long the breaker stays open before allowing a
+	// half-open probe. Defaults to 30s.
+	BreakerTimeout time.Duration
+}
+
+// cachingLayer is the configured state backing Client.hasPermissionCached.
+type cachingLayer struct {
+	cache    PermissionCache
+	allowTTL time.Duration
+	denyTTL  time.Duration
+	policy   FailurePolicy
+	observer Observer
+	breaker  *gobreaker.CircuitBreaker
+	group    singleflight.Group
+}
+
+// SetPermissionCache installs a caching, singleflight-collapsing, circuit
+// breaker protected layer in front of PermissionValidateForRequest. Without
+// this, HasPermission (and friends) hit the remote permission service on
+// every call, which is a latency and availability hazard for protected
+// handlers.
+func (c *Client) SetPermissionCache(cfg PermissionCacheConfig) {
+	if cfg.Cache == nil {
+		cfg.Cache = NewLRUPermissionCache(1024)
+	}
+	if cfg.AllowTTL == 0 {
+		cfg.AllowTTL = 5 * time.Minute
+	}
+	if cfg.DenyTTL == 0 {
+		cfg.DenyTTL = 30 * time.Second
+	}
+	if cfg.BreakerMaxFailures == 0 {
+		cfg.BreakerMaxFailures = 5
+	}
+	if cfg.BreakerTimeout == 0 {
+		cfg.BreakerTimeout = 30 * time.Second
+	}
+
+	layer := &cachingLayer{
+		cache:    cfg.Cache,
+		allowTTL: cfg.AllowTTL,
+		denyTTL:  cfg.DenyTTL,
+		policy:   cfg.FailurePolicy,
+		observer: cfg.Observer,
+	}
+	layer.breaker = gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		Name: "cas-permission-validate",
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures >= cfg.BreakerMaxFailures
+		},
+		Timeout: cfg.BreakerTimeout,
+		OnStateChange: func(name string, from, to gobreaker.State) {
+			if layer.observer != nil {
+				layer.observer.OnBreakerStateChange(name, from, to)
+			}
+		},
+	})
+	c.permCache = layer
+}
+
+// hasPermissionCached checks key via the configured caching layer,
+// collapsing concurrent checks for the same key into a single upstream
+// validate call and falling straight through to validate when no layer has
+// been configured.
+func (c *Client) hasPermissionCached(key CacheKey, validate func() error) bool {
+	layer := c.permCache
+	if layer == nil {
+		return validate() == nil
+	}
+
+	if allowed, found := layer.cache.Get(key); found {
+		if layer.observer != nil {
+			layer.observer.OnCacheHit(key)
+		}
+		return allowed
+	}
+	if layer.observer != nil {
+		layer.observer.OnCacheMiss(key)
+	}
+
+	_, err, _ := layer.group.Do(key.String(), func() (interface{}, error) {
+		return layer.breaker.Execute(func() (interface{}, error) {
+			return nil, validate()
+		})
+	})
+
+	if err == nil {
+		layer.cache.Set(key, true, layer.allowTTL)
+		return true
+	}
+
+	if err == gobreaker.ErrOpenState || err == gobreaker.ErrTooManyRequests {
+		switch layer.policy {
+		case FailurePolicyAllowAll:
+			return true
+		case FailurePolicyServeStale:
+			if allowed, found := layer.cache.GetStale(key); found {
+				return allowed
+			}
+		}
+		return false
+	}
+
+	layer.cache.Set(key, false, layer.denyTTL)
+	return false
+}
+
+// callWithBreaker runs fn, a remote permission-service call, through the
+// configured circuit breaker and singleflight group so that an unavailable
+// backend fails fast instead of piling up slow requests. Unlike
+// hasPermissionCached it doesn't cache fn's result: RoleList, PermissionList
+// and UserInfo return payloads the bool-shaped PermissionCache can't hold.
+func (c *Client) callWithBreaker(key string, fn func() (interface{}, error)) (interface{}, error) {
+	layer := c.permCache
+	if layer == nil {
+		return fn()
+	}
+	v, err, _ := layer.group.Do(key, func() (interface{}, error) {
+		return layer.breaker.Execute(fn)
+	})
+	return v, err
+}
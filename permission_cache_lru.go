@@ -0,0 +1,99 @@
+package cas
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// NewLRUPermissionCache creates a thread-safe, in-memory PermissionCache
+// holding at most size entries, evicting the least recently used entry once
+// full. It's the default PermissionCache used by SetPermissionCache.
+func NewLRUPermissionCache(size int) PermissionCache {
+	return &lruPermissionCache{
+		size:  size,
+		items: make(map[CacheKey]*list.Element),
+		order: list.New(),
+	}
+}
+
+type lruEntry struct {
+	key       CacheKey
+	allowed   bool
+	expiresAt time.Time
+}
+
+type lruPermissionCache struct {
+	mu    sync.Mutex
+	size  int
+	items map[CacheKey]*list.Element
+	order *list.List
+}
+
+func (c *lruPermissionCache) Get(key CacheKey) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return false, false
+	}
+	entry := el.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		// Leave the expired entry in place rather than evicting it here --
+		// GetStale needs it to still be around for FailurePolicyServeStale.
+		// It's cleared out eventually by ordinary LRU eviction or Set/
+		// Invalidate overwriting the key.
+		return false, false
+	}
+	c.order.MoveToFront(el)
+	return entry.allowed, true
+}
+
+// GetStale returns the last cached result for key regardless of expiry, for
+// FailurePolicyServeStale to fall back to while the breaker is open.
+func (c *lruPermissionCache) GetStale(key CacheKey) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return false, false
+	}
+	entry := el.Value.(*lruEntry)
+	return entry.allowed, true
+}
+
+func (c *lruPermissionCache) Set(key CacheKey, allowed bool, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*lruEntry)
+		entry.allowed = allowed
+		entry.expiresAt = time.Now().Add(ttl)
+		c.order.MoveToFront(el)
+		return
+	}
+
+	el := c.order.PushFront(&lruEntry{key: key, allowed: allowed, expiresAt: time.Now().Add(ttl)})
+	c.items[key] = el
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		if oldest == nil {
+			break
+		}
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (c *lruPermissionCache) Invalidate(key CacheKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.order.Remove(el)
+		delete(c.items, key)
+	}
+}
@@ -0,0 +1,89 @@
+// Package permredis is a Redis-backed cas.PermissionCache for deployments
+// that want permission check results shared across instances instead of
+// cached independently (and inconsistently) per process.
+package permredis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	cas "github.com/tmsong/cas-go-client"
+)
+
+// staleExtension is how much longer than the logical TTL an entry is kept
+// alive in Redis, so GetStale still has something to serve under
+// cas.FailurePolicyServeStale instead of the physical Redis TTL hard-deleting
+// "expired" entries before a caller ever asks for them stale.
+const staleExtension = 30 * time.Minute
+
+// Cache implements cas.PermissionCache on top of a redis.Client.
+type Cache struct {
+	rdb    *redis.Client
+	prefix string
+	ctx    context.Context
+}
+
+// New creates a Cache storing entries under prefix in rdb. ctx bounds every
+// Redis call the Cache makes; pass context.Background() if the calls should
+// never be cancelled independently of the process lifetime.
+func New(ctx context.Context, rdb *redis.Client, prefix string) *Cache {
+	return &Cache{rdb: rdb, prefix: prefix, ctx: ctx}
+}
+
+type cacheEntry struct {
+	Allowed   bool      `json:"allowed"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func (c *Cache) redisKey(key cas.CacheKey) string {
+	return fmt.Sprintf("%s%s|%s|%s", c.prefix, key.User, key.Resource, key.Action)
+}
+
+func (c *Cache) get(key cas.CacheKey) (cacheEntry, bool) {
+	data, err := c.rdb.Get(c.ctx, c.redisKey(key)).Bytes()
+	if err != nil {
+		return cacheEntry{}, false
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return cacheEntry{}, false
+	}
+	return e, true
+}
+
+// Get implements cas.PermissionCache.
+func (c *Cache) Get(key cas.CacheKey) (allowed bool, found bool) {
+	e, ok := c.get(key)
+	if !ok || time.Now().After(e.ExpiresAt) {
+		return false, false
+	}
+	return e.Allowed, true
+}
+
+// GetStale implements cas.PermissionCache, ignoring ExpiresAt as long as the
+// entry hasn't fallen out of Redis's own, longer-lived physical TTL yet.
+func (c *Cache) GetStale(key cas.CacheKey) (allowed bool, found bool) {
+	e, ok := c.get(key)
+	if !ok {
+		return false, false
+	}
+	return e.Allowed, true
+}
+
+// Set implements cas.PermissionCache.
+func (c *Cache) Set(key cas.CacheKey, allowed bool, ttl time.Duration) {
+	data, err := json.Marshal(cacheEntry{Allowed: allowed, ExpiresAt: time.Now().Add(ttl)})
+	if err != nil {
+		return
+	}
+	c.rdb.Set(c.ctx, c.redisKey(key), data, ttl+staleExtension)
+}
+
+// Invalidate implements cas.PermissionCache.
+func (c *Cache) Invalidate(key cas.CacheKey) {
+	c.rdb.Del(c.ctx, c.redisKey(key))
+}
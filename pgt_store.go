@@ -0,0 +1,72 @@
+package cas
+
+import (
+	"fmt"
+	"sync"
+)
+
+// PGTStore is the extension point for persisting Proxy Granting Tickets.
+// ProxyCallbackHandler saves the pgtId the CAS server resolves for a given
+// pgtIou; resolveProxyGrantingTicket later reads it back by the pgtIou a
+// validate response carries, yielding the PGT that RequestProxyTicket takes
+// to mint proxy tickets. It mirrors the TicketStore extension point used for service
+// tickets: an in-memory default is provided for single instance deployments,
+// and applications may supply their own (e.g. Redis backed) implementation
+// for multi-instance deployments.
+type PGTStore interface {
+	// Save associates a pgtIou with the pgtId the CAS server resolved it to.
+	Save(pgtIou, pgtId string) error
+	// Read returns the pgtId previously saved for pgtIou.
+	Read(pgtIou string) (string, error)
+	// Delete removes any pgtId saved for pgtIou.
+	Delete(pgtIou string) error
+}
+
+// NewInMemoryPGTStore creates a new thread-safe, memory backed PGTStore.
+//
+// As with the in-memory ticket store, this is only appropriate for single
+// instance deployments.
+func NewInMemoryPGTStore() PGTStore {
+	return &memoryPGTStore{pgts: make(map[string]string)}
+}
+
+type memoryPGTStore struct {
+	mu   sync.RWMutex
+	pgts map[string]string
+}
+
+func (s *memoryPGTStore) Save(pgtIou, pgtId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pgts[pgtIou] = pgtId
+	return nil
+}
+
+func (s *memoryPGTStore) Read(pgtIou string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	pgtId, ok := s.pgts[pgtIou]
+	if !ok {
+		return "", fmt.Errorf("cas: no pgt found for iou %v", pgtIou)
+	}
+	return pgtId, nil
+}
+
+func (s *memoryPGTStore) Delete(pgtIou string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pgts, pgtIou)
+	return nil
+}
+
+// SetPGTStore sets the PGTStore used to resolve the Proxy Granting Tickets
+// delivered asynchronously to the proxy callback. There is no default here:
+// call this explicitly if the ProxyCallbackHandler needs to share a store
+// across instances (e.g. Redis backed). WithPGTURL wires up a validator-
+// private NewInMemoryPGTStore on Client.pgts if it's still nil by the time
+// the proxy-enabled validator is constructed, so resolveProxyGrantingTicket
+// never has to read through a nil store -- but that only happens once
+// WithPGTURL runs, not merely by leaving SetPGTStore uncalled.
+func (c *Client) SetPGTStore(store PGTStore) {
+	c.pgts = store
+}
@@ -0,0 +1,223 @@
+package cas
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/golang/glog"
+)
+
+// proxyResponseXML is the CAS /proxy endpoint's cas:serviceResponse body.
+type proxyResponseXML struct {
+	XMLName xml.Name `xml:"http://www.yale.edu/tp/cas serviceResponse"`
+	Success *struct {
+		ProxyTicket string `xml:"proxyTicket"`
+	} `xml:"proxySuccess"`
+	Failure *struct {
+		Code        string `xml:"code,attr"`
+		Description string `xml:",chardata"`
+	} `xml:"proxyFailure"`
+}
+
+// proxyTicketResponse is the parsed result of a /proxy request.
+type proxyTicketResponse struct {
+	ProxyTicket string
+}
+
+// parseProxyResponse decodes the CAS /proxy endpoint's response body.
+func parseProxyResponse(body []byte) (*proxyTicketResponse, error) {
+	var resp proxyResponseXML
+	if err := xml.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("cas: decode proxy response: %v", err)
+	}
+	if resp.Failure != nil {
+		return nil, fmt.Errorf("cas: request proxy ticket: %v: %v", resp.Failure.Code, resp.Failure.Description)
+	}
+	if resp.Success == nil {
+		return nil, fmt.Errorf("cas: request proxy ticket: response missing proxySuccess")
+	}
+	return &proxyTicketResponse{ProxyTicket: resp.Success.ProxyTicket}, nil
+}
+
+// ProxyCallbackHandler handles the CAS proxy callback (CAS protocol 2.5.4).
+// When a service ticket is validated with a pgtUrl, the CAS server makes a
+// server-to-server HTTPS GET back to that URL carrying pgtId and pgtIou, so
+// the client can resolve the PGTIOU returned synchronously in the validate
+// response to the real PGT it needs to request proxy tickets. Mount an
+// instance of this handler on the HTTPS URL passed to WithPGTURL.
+type ProxyCallbackHandler struct {
+	store PGTStore
+}
+
+// NewProxyCallbackHandler creates a ProxyCallbackHandler backed by store.
+func NewProxyCallbackHandler(store PGTStore) *ProxyCallbackHandler {
+	return &ProxyCallbackHandler{store: store}
+}
+
+// ServeHTTP saves the pgtId/pgtIou pair from the callback request.
+//
+// The CAS server also calls pgtUrl once, bare, to validate the callback
+// endpoint's TLS certificate before a real ticket is ever issued against it;
+// that ping carries neither parameter and is answered with a plain 200.
+func (h *ProxyCallbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	pgtID := r.FormValue("pgtId")
+	pgtIOU := r.FormValue("pgtIou")
+	if pgtID == "" || pgtIOU == "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if err := h.store.Save(pgtIOU, pgtID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// resolveProxyGrantingTicket swaps the PGTIOU the CAS server returned inline
+// in success.ProxyGrantingTicket for the real PGT the server delivered
+// out-of-band to the pgtUrl callback. It's a no-op when the validator has no
+// pgtUrl configured, the response carried no PGTIOU, or the PGT store
+// doesn't (yet) have a matching entry -- the callback request can race the
+// validate response, so callers that need the PGT should be prepared to
+// retry.
+func (validator *ServiceTicketValidator) resolveProxyGrantingTicket(success *AuthenticationResponse) {
+	if validator.pgtURL == "" || success == nil || success.ProxyGrantingTicket == "" || validator.cli == nil {
+		return
+	}
+	// WithPGTURL wires up an in-memory default whenever pgtURL is set, but
+	// guard against a nil store regardless -- e.g. a PGTStore explicitly
+	// cleared after construction -- rather than risk a panic here.
+	if validator.cli.pgts == nil {
+		return
+	}
+	pgtID, err := validator.cli.pgts.Read(success.ProxyGrantingTicket)
+	if err != nil {
+		if glog.V(2) {
+			glog.Infof("cas: no pgt resolved yet for iou %v: %v", success.ProxyGrantingTicket, err)
+		}
+		return
+	}
+	success.ProxyGrantingTicket = pgtID
+}
+
+// RequestProxyTicket requests a proxy ticket for targetService using pgt, a
+// Proxy Granting Ticket previously resolved via the proxy callback (CAS
+// protocol 2.5). The returned ticket can be presented to targetService the
+// same way a regular service ticket would be.
+func (c *Client) RequestProxyTicket(pgt, targetService string) (string, error) {
+	u, err := c.stValidator.casURL.Parse(path.Join(c.stValidator.casURL.Path, "proxy"))
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Add("pgt", pgt)
+	q.Add("targetService", targetService)
+	u.RawQuery = q.Encode()
+
+	r, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	r.Header.Add("User-Agent", "Golang CAS client gopkg.in/cas")
+
+	if glog.V(2) {
+		glog.Infof("Requesting proxy ticket for %v with %v", targetService, r.URL)
+	}
+
+	resp, err := c.cli.Do(r)
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cas: request proxy ticket: %v", string(data))
+	}
+
+	proxyResponse, err := parseProxyResponse(data)
+	if err != nil {
+		return "", err
+	}
+	return proxyResponse.ProxyTicket, nil
+}
+
+// validateTicketProxy validates a proxy ticket against serviceURL via
+// /proxyValidate, which additionally resolves the chain of proxies (CAS
+// protocol 2.6) that obtained the ticket on the end user's behalf.
+func (validator *ServiceTicketValidator) validateTicketProxy(serviceURL *url.URL, ticket string) (*AuthenticationResponse, error) {
+	u, err := validator.ValidateUrlProxy(serviceURL, ticket)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Add("User-Agent", "Golang CAS client gopkg.in/cas")
+
+	if glog.V(2) {
+		glog.Infof("Attempting proxy ticket validation with %v", r.URL)
+	}
+
+	resp, err := validator.client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	body := string(data)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cas: validate proxy ticket: %v", body)
+	}
+	if body == "no\n\n" {
+		return nil, nil // not logged in
+	}
+
+	var success *AuthenticationResponse
+	if validator.responseFormat == JSONFormat {
+		success, err = parseServiceResponseJSON(data)
+	} else {
+		body = zonedTimestampSuffix.ReplaceAllString(body, "")
+		success, err = ParseServiceResponse([]byte(body))
+	}
+	if err != nil {
+		return nil, err
+	}
+	validator.resolveProxyGrantingTicket(success)
+	return success, nil
+}
+
+// ValidateUrlProxy creates the proxy ticket validation url (CAS protocol
+// 2.6, /proxyValidate).
+func (validator *ServiceTicketValidator) ValidateUrlProxy(serviceURL *url.URL, ticket string) (string, error) {
+	u, err := validator.casURL.Parse(path.Join(validator.casURL.Path, "proxyValidate"))
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	q.Add("service", sanitisedURLString(serviceURL))
+	q.Add("ticket", ticket)
+	if validator.responseFormat == JSONFormat {
+		q.Add("format", "json")
+	}
+	if validator.pgtURL != "" {
+		q.Add("pgtUrl", validator.pgtURL)
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
@@ -0,0 +1,146 @@
+package cas
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// casTime decodes CAS authenticationDate values, which may be plain RFC3339
+// or the Java-style zoned form CAS servers emit,
+// e.g. "2023-01-15T10:00:00.000+08:00[Asia/Shanghai]". The trailing
+// "[IANA/Zone]" is not part of RFC3339; it's stripped before parsing and the
+// named zone is then applied so the resulting time.Time keeps the intended
+// wall clock instead of only the fixed offset carried in the RFC3339 prefix.
+//
+// casTime is only wired up as the JSON authenticationDate field's type
+// (casAuthenticationSuccessJSON, below). The default XMLFormat path still
+// goes through the XML AuthenticationResponse's own time field via
+// ParseServiceResponse, which zonedTimestampSuffix only strips the bracketed
+// zone name from -- the zone itself is discarded there, not applied, so
+// authenticationDate on the XML path carries the offset CAS sent but not
+// necessarily the named zone's wall clock. Request JSONFormat for fully
+// zone-aware timestamps.
+type casTime struct {
+	time.Time
+}
+
+func parseZonedTimestamp(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	zone := ""
+	if idx := strings.IndexByte(s, '['); idx != -1 && strings.HasSuffix(s, "]") {
+		zone = s[idx+1 : len(s)-1]
+		s = s[:idx]
+	}
+
+	t, err := time.Parse("2006-01-02T15:04:05.000Z07:00", s)
+	if err != nil {
+		t, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("cas: parse authenticationDate %q: %v", s, err)
+		}
+	}
+
+	if zone == "" {
+		return t, nil
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		// Fall back to the offset already carried in the timestamp rather
+		// than failing the whole response over an unrecognised zone name.
+		return t, nil
+	}
+	return t.In(loc), nil
+}
+
+func (ct *casTime) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	t, err := parseZonedTimestamp(s)
+	if err != nil {
+		return err
+	}
+	ct.Time = t
+	return nil
+}
+
+// casServiceResponseJSON is the CAS v3 serviceResponse envelope as rendered
+// by format=json.
+type casServiceResponseJSON struct {
+	ServiceResponse struct {
+		AuthenticationSuccess *casAuthenticationSuccessJSON `json:"authenticationSuccess"`
+		AuthenticationFailure *casAuthenticationFailureJSON `json:"authenticationFailure"`
+	} `json:"serviceResponse"`
+}
+
+type casAuthenticationFailureJSON struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+type casAuthenticationSuccessJSON struct {
+	User                                   string                    `json:"user"`
+	Attributes                             map[string][]interface{} `json:"attributes"`
+	AuthenticationDate                     casTime                   `json:"authenticationDate"`
+	IsFromNewLogin                         bool                      `json:"isFromNewLogin"`
+	LongTermAuthenticationRequestTokenUsed bool                      `json:"longTermAuthenticationRequestTokenUsed"`
+	ProxyGrantingTicket                    string                    `json:"proxyGrantingTicket"`
+	Proxies                                []string                  `json:"proxies"`
+}
+
+// parseServiceResponseJSON decodes a CAS v3 serviceResponse requested with
+// format=json, as an alternative to the XML decoding ParseServiceResponse
+// performs for the default format.
+//
+// casAuthenticationSuccessJSON assumes authenticationDate, isFromNewLogin,
+// longTermAuthenticationRequestTokenUsed, proxyGrantingTicket and proxies are
+// siblings of attributes on authenticationSuccess, matching the Apereo CAS
+// reference implementation's format=json rendering. Some CAS deployments
+// instead nest one or more of these inside the attributes map itself; if
+// this client is being pointed at such a server, verify the actual
+// format=json payload it returns before relying on AuthenticationDate et al.
+// here -- a shape mismatch decodes silently to the zero value rather than an
+// error.
+func parseServiceResponseJSON(body []byte) (*AuthenticationResponse, error) {
+	var raw casServiceResponseJSON
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("cas: decode json service response: %v", err)
+	}
+
+	if f := raw.ServiceResponse.AuthenticationFailure; f != nil {
+		return nil, fmt.Errorf("cas: validate ticket: %v: %v", f.Code, f.Description)
+	}
+
+	s := raw.ServiceResponse.AuthenticationSuccess
+	if s == nil {
+		return nil, fmt.Errorf("cas: validate ticket: json service response missing authenticationSuccess")
+	}
+
+	attributes := UserAttributes(s.Attributes)
+	var memberOf []string
+	if v, ok := attributes["memberOf"]; ok {
+		for _, m := range v {
+			if str, ok := m.(string); ok {
+				memberOf = append(memberOf, str)
+			}
+		}
+	}
+
+	return &AuthenticationResponse{
+		User:                s.User,
+		Attributes:          attributes,
+		MemberOf:            memberOf,
+		AuthenticationDate:  s.AuthenticationDate.Time,
+		IsNewLogin:          s.IsFromNewLogin,
+		IsRememberedLogin:   s.LongTermAuthenticationRequestTokenUsed,
+		ProxyGrantingTicket: s.ProxyGrantingTicket,
+		Proxies:             s.Proxies,
+	}, nil
+}
@@ -6,18 +6,74 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"regexp"
 	"strings"
 
 	"github.com/golang/glog"
 )
 
+// zonedTimestampSuffix matches the trailing "[IANA/Zone]" suffix CAS servers
+// append to authenticationDate in the XML response, e.g.
+// "2023-01-15T10:00:00.000+08:00[Asia/Shanghai]".
+var zonedTimestampSuffix = regexp.MustCompile(`\[[\w/]+\]`)
+
+// ResponseFormat selects the wire format requested from the CAS server's
+// validate endpoints.
+type ResponseFormat string
+
+const (
+	// XMLFormat is the CAS default and the only format validateTicketCas3
+	// supported historically.
+	XMLFormat ResponseFormat = "xml"
+	// JSONFormat requests the CAS v3 JSON rendering of serviceResponse via
+	// format=json, which decodes timestamps without the XML unmarshaller's
+	// zoned-timestamp limitations.
+	JSONFormat ResponseFormat = "json"
+)
+
+// ValidatorOption configures optional ServiceTicketValidator behaviour.
+type ValidatorOption func(*ServiceTicketValidator)
+
+// WithResponseFormat selects the response format requested from the CAS
+// server for the p3/serviceValidate and proxyValidate endpoints; proxy
+// tickets (PT-...) go through proxyValidate under CAS2 as well as CAS3. It has
+// no effect on CAS1 validation or on CAS2 service ticket validation via
+// serviceValidate. Defaults to XMLFormat for back-compat.
+func WithResponseFormat(format ResponseFormat) ValidatorOption {
+	return func(v *ServiceTicketValidator) {
+		v.responseFormat = format
+	}
+}
+
+// WithPGTURL enables the CAS proxy flow (protocol 2.5/2.6) by setting the
+// pgtUrl sent with serviceValidate/p3-serviceValidate requests. pgtURL must
+// be an HTTPS callback URL mounting a ProxyCallbackHandler backed by the
+// same PGTStore as cli -- set one explicitly with Client.SetPGTStore before
+// constructing the validator if the callback handler needs to share it; a
+// validator-private in-memory store is wired up here otherwise, so
+// resolveProxyGrantingTicket never has to read through a nil PGTStore.
+func WithPGTURL(pgtURL string) ValidatorOption {
+	return func(v *ServiceTicketValidator) {
+		v.pgtURL = pgtURL
+		if v.cli != nil && v.cli.pgts == nil {
+			v.cli.pgts = NewInMemoryPGTStore()
+		}
+	}
+}
+
 // NewServiceTicketValidator create a new *ServiceTicketValidator
-func NewServiceTicketValidator(client *http.Client, casURL *url.URL, validationType string) *ServiceTicketValidator {
-	return &ServiceTicketValidator{
+func NewServiceTicketValidator(client *http.Client, casURL *url.URL, validationType string, cli *Client, opts ...ValidatorOption) *ServiceTicketValidator {
+	v := &ServiceTicketValidator{
 		client:         client,
 		casURL:         casURL,
 		validationType: validationType,
+		cli:            cli,
+		responseFormat: XMLFormat,
+	}
+	for _, opt := range opts {
+		opt(v)
 	}
+	return v
 }
 
 // ServiceTicketValidator is responsible for the validation of a service ticket
@@ -25,6 +81,9 @@ type ServiceTicketValidator struct {
 	client         *http.Client
 	casURL         *url.URL
 	validationType string
+	cli            *Client
+	responseFormat ResponseFormat
+	pgtURL         string
 }
 
 // ValidateTicket validates the service ticket for the given server. The method will try to use the service validate
@@ -34,6 +93,12 @@ func (validator *ServiceTicketValidator) ValidateTicket(serviceURL *url.URL, tic
 	if glog.V(2) {
 		glog.Infof("Validating ticket %v for service %v", ticket, serviceURL)
 	}
+	// Proxy tickets (PT-...) aren't accepted by the plain validate/
+	// serviceValidate endpoints and must go through proxyValidate so the
+	// proxy chain that obtained them gets resolved too.
+	if strings.HasPrefix(ticket, "PT-") && validator.validationType != "CAS1" {
+		return validator.validateTicketProxy(serviceURL, ticket)
+	}
 	if validator.validationType == "CAS1" {
 		return validator.validateTicketCas1(serviceURL, ticket)
 	} else if validator.validationType == "CAS2" {
@@ -82,6 +147,7 @@ func (validator *ServiceTicketValidator) validateTicketCas2(serviceURL *url.URL,
 	if glog.V(2) {
 		glog.Infof("Parsed ServiceResponse: %#v", success)
 	}
+	validator.resolveProxyGrantingTicket(success)
 	return success, nil
 }
 
@@ -96,6 +162,9 @@ func (validator *ServiceTicketValidator) ServiceValidateUrl(serviceURL *url.URL,
 	q := u.Query()
 	q.Add("service", sanitisedURLString(serviceURL))
 	q.Add("ticket", ticket)
+	if validator.pgtURL != "" {
+		q.Add("pgtUrl", validator.pgtURL)
+	}
 	u.RawQuery = q.Encode()
 
 	return u.String(), nil
@@ -225,15 +294,26 @@ func (validator *ServiceTicketValidator) validateTicketCas3(serviceURL *url.URL,
 	if body == "no\n\n" {
 		return nil, nil // not logged in
 	}
-	//todo 这里由于无法解析带时区的时间字符串，故先替换掉
-	body = strings.Replace(body, "[Asia/Shanghai]", "", 1)
-	success, err := ParseServiceResponse([]byte(body))
+
+	var success *AuthenticationResponse
+	if validator.responseFormat == JSONFormat {
+		success, err = parseServiceResponseJSON(data)
+	} else {
+		// The XML AuthenticationResponse unmarshaller can't cope with the
+		// Java-style zoned timestamp CAS emits for authenticationDate, e.g.
+		// "2023-01-15T10:00:00.000+08:00[Asia/Shanghai]" -- RFC3339 has no
+		// room for the trailing "[IANA/Zone]" suffix. Strip it before
+		// unmarshalling; JSONFormat avoids this entirely via casTime.
+		body = zonedTimestampSuffix.ReplaceAllString(body, "")
+		success, err = ParseServiceResponse([]byte(body))
+	}
 	if err != nil {
 		return nil, err
 	}
 	if glog.V(2) {
 		glog.Infof("Parsed ServiceResponse: %#v", success)
 	}
+	validator.resolveProxyGrantingTicket(success)
 	return success, nil
 }
 
@@ -248,7 +328,12 @@ func (validator *ServiceTicketValidator) ValidateUrl3(serviceURL *url.URL, ticke
 	q := u.Query()
 	q.Add("service", sanitisedURLString(serviceURL))
 	q.Add("ticket", ticket)
-	//q.Add("format", "json")
+	if validator.responseFormat == JSONFormat {
+		q.Add("format", "json")
+	}
+	if validator.pgtURL != "" {
+		q.Add("pgtUrl", validator.pgtURL)
+	}
 	u.RawQuery = q.Encode()
 
 	return u.String(), nil
@@ -0,0 +1,91 @@
+// Package sloredis relays CAS single-logout events across application
+// instances that share a TicketStore, using Redis pub/sub, so that a
+// back-channel logout received by one instance actually logs every instance
+// out rather than just the one the CAS server happened to call back.
+package sloredis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/golang/glog"
+
+	cas "github.com/tmsong/cas-go-client"
+)
+
+// Publisher relays SLOEvents a Client publishes to its SLOBroadcast channel
+// onto a Redis pub/sub channel, for Subscribe to pick up on other instances.
+type Publisher struct {
+	rdb     *redis.Client
+	channel string
+	events  chan cas.SLOEvent
+}
+
+// NewPublisher creates a Publisher and wires it to client's SLOBroadcast.
+func NewPublisher(client *cas.Client, rdb *redis.Client, channel string) *Publisher {
+	events := make(chan cas.SLOEvent, 64)
+	client.SetSLOBroadcast(events)
+	return &Publisher{rdb: rdb, channel: channel, events: events}
+}
+
+// Run publishes events to Redis until ctx is cancelled, or until an event
+// fails to marshal or publish, in which case it returns that error.
+func (p *Publisher) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event := <-p.events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				return fmt.Errorf("sloredis: marshal event: %v", err)
+			}
+			if err := p.rdb.Publish(ctx, p.channel, data).Err(); err != nil {
+				return fmt.Errorf("sloredis: publish: %v", err)
+			}
+		}
+	}
+}
+
+// Subscribe applies single logouts published to channel by a Publisher on
+// another instance to client's TicketStore, until ctx is cancelled.
+//
+// Events this same process published -- i.e. a back-channel logout this
+// instance handled locally and then relayed via its own Publisher -- are
+// recognized by OriginID and skipped, rather than applied a second time to a
+// ticket this instance already deleted. A single event failing to apply
+// (e.g. a transient TicketStore error that outlasted HandleRemoteLogout's
+// own retries) is logged and skipped rather than ending the subscription,
+// since the whole point of this loop is to keep relaying logouts for the
+// life of the process; one bad event shouldn't silently stop every
+// subsequent one from being applied.
+func Subscribe(ctx context.Context, client *cas.Client, rdb *redis.Client, channel string) error {
+	sub := rdb.Subscribe(ctx, channel)
+	defer sub.Close()
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			var event cas.SLOEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				glog.Warningf("sloredis: decode event: %v", err)
+				continue
+			}
+			if event.OriginID != "" && event.OriginID == cas.LocalSLOInstanceID() {
+				continue
+			}
+			if err := client.HandleRemoteLogout(event.SessionIndex, event.NameID); err != nil {
+				glog.Warningf("sloredis: apply remote logout for session %v: %v", event.SessionIndex, err)
+				continue
+			}
+		}
+	}
+}